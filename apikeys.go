@@ -0,0 +1,386 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKey is a single issued credential. Scopes gate which endpoints the key
+// may call (e.g. "convert:libreoffice", "convert:url"); the quota and rate
+// limit fields bound how much it can be used.
+type APIKey struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Key                string    `json:"key,omitempty"` // only populated on creation
+	Scopes             []string  `json:"scopes"`
+	MonthlyPageQuota   int       `json:"monthlyPageQuota"`
+	MonthlyByteQuota   int64     `json:"monthlyByteQuota"`
+	RateLimitPerMinute int       `json:"rateLimitPerMinute"`
+	CreatedAt          time.Time `json:"createdAt"`
+
+	Usage KeyUsage `json:"usage"`
+}
+
+// KeyUsage tracks consumption for the current billing period and the
+// rate-limit token bucket. PagesUsed/BytesIn/BytesOut/Requests reset once 30
+// days have passed since PeriodStart (checked lazily on each request).
+type KeyUsage struct {
+	PeriodStart time.Time `json:"periodStart"`
+	PagesUsed   int       `json:"pagesUsed"`
+	BytesIn     int64     `json:"bytesIn"`
+	BytesOut    int64     `json:"bytesOut"`
+	Requests    int       `json:"requests"`
+
+	tokens     float64
+	lastRefill time.Time
+}
+
+func (k *APIKey) hasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore persists API keys and their usage counters. FileKeyStore is the
+// default, writing each key to disk so issued keys and quota usage survive a
+// restart; MemoryKeyStore satisfies the same interface for tests or
+// single-shot deployments where losing keys on restart is acceptable.
+type KeyStore interface {
+	Create(key *APIKey) error
+	GetByKey(secret string) (*APIKey, error)
+	Get(id string) (*APIKey, error)
+	List() []*APIKey
+	RecordUsage(id string, pages int, bytesIn, bytesOut int64) error
+	Allow(id string) (bool, time.Duration)
+	// CheckQuota reports whether key id is still within its monthly page and
+	// byte quotas. It takes the store's lock, so callers get a consistent
+	// read of Usage instead of racing with a concurrent RecordUsage for the
+	// same key.
+	CheckQuota(id string) (ok bool, reason string, err error)
+}
+
+// MemoryKeyStore is a lightweight KeyStore for tests or single-instance
+// deployments where key/quota state does not need to survive a restart,
+// matching MemoryJobStore's shape.
+type MemoryKeyStore struct {
+	mu       sync.Mutex
+	byID     map[string]*APIKey
+	bySecret map[string]*APIKey
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		byID:     make(map[string]*APIKey),
+		bySecret: make(map[string]*APIKey),
+	}
+}
+
+func (s *MemoryKeyStore) Create(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.Usage.PeriodStart = time.Now()
+	key.Usage.tokens = float64(key.RateLimitPerMinute)
+	key.Usage.lastRefill = time.Now()
+	s.byID[key.ID] = key
+	s.bySecret[key.Key] = key
+	return nil
+}
+
+func (s *MemoryKeyStore) GetByKey(secret string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.bySecret[secret]
+	if !ok {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	return key, nil
+}
+
+func (s *MemoryKeyStore) Get(id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("key not found: %s", id)
+	}
+	return key, nil
+}
+
+func (s *MemoryKeyStore) List() []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*APIKey, 0, len(s.byID))
+	for _, k := range s.byID {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *MemoryKeyStore) resetIfNewPeriod(key *APIKey) {
+	if time.Since(key.Usage.PeriodStart) >= 30*24*time.Hour {
+		key.Usage.PeriodStart = time.Now()
+		key.Usage.PagesUsed = 0
+		key.Usage.BytesIn = 0
+		key.Usage.BytesOut = 0
+		key.Usage.Requests = 0
+	}
+}
+
+func (s *MemoryKeyStore) RecordUsage(id string, pages int, bytesIn, bytesOut int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return fmt.Errorf("key not found: %s", id)
+	}
+	s.resetIfNewPeriod(key)
+	key.Usage.PagesUsed += pages
+	key.Usage.BytesIn += bytesIn
+	key.Usage.BytesOut += bytesOut
+	key.Usage.Requests++
+	return nil
+}
+
+// CheckQuota reports whether key id is within its monthly page and byte
+// quotas, taking s.mu so the read can't race with a concurrent RecordUsage
+// tearing the same fields.
+func (s *MemoryKeyStore) CheckQuota(id string) (bool, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return false, "", fmt.Errorf("key not found: %s", id)
+	}
+	s.resetIfNewPeriod(key)
+	if key.MonthlyPageQuota > 0 && key.Usage.PagesUsed >= key.MonthlyPageQuota {
+		return false, "monthly page quota exceeded", nil
+	}
+	if key.MonthlyByteQuota > 0 && key.Usage.BytesIn+key.Usage.BytesOut >= key.MonthlyByteQuota {
+		return false, "monthly byte quota exceeded", nil
+	}
+	return true, "", nil
+}
+
+// Allow implements a token-bucket rate limiter: the bucket refills at
+// RateLimitPerMinute tokens/minute and holds at most that many tokens.
+// It returns false and a suggested Retry-After duration when empty.
+func (s *MemoryKeyStore) Allow(id string) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return false, 0
+	}
+	if key.RateLimitPerMinute <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(key.Usage.lastRefill).Seconds()
+	refillRate := float64(key.RateLimitPerMinute) / 60.0
+	key.Usage.tokens += elapsed * refillRate
+	if key.Usage.tokens > float64(key.RateLimitPerMinute) {
+		key.Usage.tokens = float64(key.RateLimitPerMinute)
+	}
+	key.Usage.lastRefill = now
+
+	if key.Usage.tokens < 1 {
+		wait := time.Duration((1 - key.Usage.tokens) / refillRate * float64(time.Second))
+		return false, wait
+	}
+	key.Usage.tokens--
+	return true, 0
+}
+
+// keyStore is the process-wide API key store.
+var keyStore KeyStore = newDefaultKeyStore()
+
+// newDefaultKeyStore opens a FileKeyStore under KEYS_DATA_DIR (or
+// ./data/keys) so issued keys and their usage survive a restart. Falls back
+// to an in-memory store only if the data directory can't be opened.
+func newDefaultKeyStore() KeyStore {
+	dir := os.Getenv("KEYS_DATA_DIR")
+	if dir == "" {
+		dir = "./data/keys"
+	}
+	store, err := NewFileKeyStore(dir)
+	if err != nil {
+		log.Printf("key store: %v; falling back to in-memory (keys will not survive a restart)", err)
+		return NewMemoryKeyStore()
+	}
+	return store
+}
+
+func newAPIKeySecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "zk_" + hex.EncodeToString(b)
+}
+
+// registerAdminKeyRoutes wires key management under the given group, which
+// the caller has already gated behind BasicAuth.
+func registerAdminKeyRoutes(admin *gin.RouterGroup) {
+	admin.POST("/admin/keys", handleCreateKey)
+	admin.GET("/admin/keys", handleListKeys)
+	admin.GET("/admin/keys/:id/usage", handleKeyUsage)
+}
+
+type createKeyRequest struct {
+	Name               string   `json:"name" binding:"required"`
+	Scopes             []string `json:"scopes" binding:"required"`
+	MonthlyPageQuota   int      `json:"monthlyPageQuota"`
+	MonthlyByteQuota   int64    `json:"monthlyByteQuota"`
+	RateLimitPerMinute int      `json:"rateLimitPerMinute"`
+}
+
+func handleCreateKey(c *gin.Context) {
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RateLimitPerMinute == 0 {
+		req.RateLimitPerMinute = 60
+	}
+
+	key := &APIKey{
+		ID:                 newJobID(),
+		Name:               req.Name,
+		Key:                newAPIKeySecret(),
+		Scopes:             req.Scopes,
+		MonthlyPageQuota:   req.MonthlyPageQuota,
+		MonthlyByteQuota:   req.MonthlyByteQuota,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		CreatedAt:          time.Now(),
+	}
+	if err := keyStore.Create(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+func handleListKeys(c *gin.Context) {
+	// Blank the secret on copies: the stored keys keep theirs so lookups and
+	// FileKeyStore's on-disk records stay intact.
+	keys := make([]APIKey, 0)
+	for _, k := range keyStore.List() {
+		kc := *k
+		kc.Key = ""
+		keys = append(keys, kc)
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func handleKeyUsage(c *gin.Context) {
+	key, err := keyStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": key.ID, "name": key.Name, "usage": key.Usage})
+}
+
+// apiKeyContextKey is how the authenticated APIKey is stashed on the Gin
+// context for downstream handlers/middleware to read.
+const apiKeyContextKey = "apiKey"
+
+// requireAPIKey validates the Bearer token, checks the monthly quota, and
+// applies the per-key rate limit. On success the resolved *APIKey is stored
+// on the context under apiKeyContextKey.
+//
+// scope is enforced here when the route only ever needs one scope (e.g.
+// /convert-url needs "convert:url" no matter what's in the request body). If
+// scope is "" the caller is responsible for checking requireScope once it
+// knows which scope applies, e.g. /convert picks "convert:libreoffice" vs.
+// "convert:chromium" based on the parsed conversionType.
+func requireAPIKey(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		secret := strings.TrimPrefix(authHeader, "Bearer ")
+		if secret == "" || secret == authHeader {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or malformed Authorization header"})
+			return
+		}
+
+		key, err := keyStore.GetByKey(secret)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+		if scope != "" && !key.hasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key lacks required scope: %s", scope)})
+			return
+		}
+		withinQuota, reason, err := keyStore.CheckQuota(key.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+		if !withinQuota {
+			c.AbortWithStatusJSON(http.StatusPaymentRequired, gin.H{"error": reason})
+			return
+		}
+
+		allowed, retryAfter := keyStore.Allow(key.ID)
+		if !allowed {
+			c.Header("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// requireScope aborts the request with 403 if the authenticated key (set by
+// requireAPIKey) doesn't carry scope. Used by handlers whose required scope
+// isn't known until the request body is parsed.
+func requireScope(c *gin.Context, scope string) bool {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or malformed Authorization header"})
+		return false
+	}
+	key := value.(*APIKey)
+	if !key.hasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key lacks required scope: %s", scope)})
+		return false
+	}
+	return true
+}
+
+// sumFileSizes totals the declared size of uploaded multipart files, used as
+// the bytesIn figure for quota accounting.
+func sumFileSizes(files []*multipart.FileHeader) int64 {
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+	return total
+}
+
+// recordAPIKeyUsage is called by handlers after a conversion completes to
+// log pages produced and bytes moved against the calling key.
+func recordAPIKeyUsage(c *gin.Context, pages int, bytesIn, bytesOut int64) {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return
+	}
+	key := value.(*APIKey)
+	keyStore.RecordUsage(key.ID, pages, bytesIn, bytesOut)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileKeyStore persists each APIKey as a JSON file on disk, mirroring
+// FileJobStore's approach, so issued keys and their page/byte usage survive
+// a restart instead of resetting every issued key's quota to zero. The
+// in-memory index (byID/bySecret) is rebuilt from disk on open and kept in
+// sync with every mutating call, so lookups stay as fast as MemoryKeyStore's.
+type FileKeyStore struct {
+	mu       sync.Mutex
+	dir      string
+	byID     map[string]*APIKey
+	bySecret map[string]*APIKey
+}
+
+// NewFileKeyStore opens (creating if needed) a FileKeyStore rooted at dir,
+// loading any keys already persisted there.
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create key store directory: %v", err)
+	}
+	s := &FileKeyStore{
+		dir:      dir,
+		byID:     make(map[string]*APIKey),
+		bySecret: make(map[string]*APIKey),
+	}
+	if err := s.loadAll(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileKeyStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileKeyStore) loadAll() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read key store directory: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read key file %s: %v", entry.Name(), err)
+		}
+		var key APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return fmt.Errorf("failed to unmarshal key file %s: %v", entry.Name(), err)
+		}
+		s.byID[key.ID] = &key
+		s.bySecret[key.Key] = &key
+	}
+	return nil
+}
+
+func (s *FileKeyStore) write(key *APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %v", err)
+	}
+	return os.WriteFile(s.path(key.ID), data, 0600)
+}
+
+func (s *FileKeyStore) Create(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.Usage.PeriodStart = time.Now()
+	key.Usage.tokens = float64(key.RateLimitPerMinute)
+	key.Usage.lastRefill = time.Now()
+	if err := s.write(key); err != nil {
+		return err
+	}
+	s.byID[key.ID] = key
+	s.bySecret[key.Key] = key
+	return nil
+}
+
+func (s *FileKeyStore) GetByKey(secret string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.bySecret[secret]
+	if !ok {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	return key, nil
+}
+
+func (s *FileKeyStore) Get(id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("key not found: %s", id)
+	}
+	return key, nil
+}
+
+func (s *FileKeyStore) List() []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*APIKey, 0, len(s.byID))
+	for _, k := range s.byID {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *FileKeyStore) resetIfNewPeriod(key *APIKey) {
+	if time.Since(key.Usage.PeriodStart) >= 30*24*time.Hour {
+		key.Usage.PeriodStart = time.Now()
+		key.Usage.PagesUsed = 0
+		key.Usage.BytesIn = 0
+		key.Usage.BytesOut = 0
+		key.Usage.Requests = 0
+	}
+}
+
+func (s *FileKeyStore) RecordUsage(id string, pages int, bytesIn, bytesOut int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return fmt.Errorf("key not found: %s", id)
+	}
+	s.resetIfNewPeriod(key)
+	key.Usage.PagesUsed += pages
+	key.Usage.BytesIn += bytesIn
+	key.Usage.BytesOut += bytesOut
+	key.Usage.Requests++
+	return s.write(key)
+}
+
+func (s *FileKeyStore) CheckQuota(id string) (bool, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return false, "", fmt.Errorf("key not found: %s", id)
+	}
+	s.resetIfNewPeriod(key)
+	if key.MonthlyPageQuota > 0 && key.Usage.PagesUsed >= key.MonthlyPageQuota {
+		return false, "monthly page quota exceeded", nil
+	}
+	if key.MonthlyByteQuota > 0 && key.Usage.BytesIn+key.Usage.BytesOut >= key.MonthlyByteQuota {
+		return false, "monthly byte quota exceeded", nil
+	}
+	return true, "", nil
+}
+
+// Allow implements the same token-bucket rate limiter as MemoryKeyStore.
+// The bucket isn't persisted to disk: losing it on restart just means the
+// bucket starts full again, which isn't a durability concern the way lost
+// quota usage is.
+func (s *FileKeyStore) Allow(id string) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return false, 0
+	}
+	if key.RateLimitPerMinute <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(key.Usage.lastRefill).Seconds()
+	refillRate := float64(key.RateLimitPerMinute) / 60.0
+	key.Usage.tokens += elapsed * refillRate
+	if key.Usage.tokens > float64(key.RateLimitPerMinute) {
+		key.Usage.tokens = float64(key.RateLimitPerMinute)
+	}
+	key.Usage.lastRefill = now
+
+	if key.Usage.tokens < 1 {
+		wait := time.Duration((1 - key.Usage.tokens) / refillRate * float64(time.Second))
+		return false, wait
+	}
+	key.Usage.tokens--
+	return true, 0
+}
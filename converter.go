@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Converter is a backend capable of turning uploaded files into a PDF (or,
+// for Chromium screenshot-style jobs, an image). GotenbergConverter is the
+// primary implementation; LocalLibreOfficeConverter and ChromiumCDPConverter
+// let the service keep working when the Gotenberg container is unreachable.
+// The returned content length is the upstream's, when known; callers should
+// treat <= 0 as "unknown" rather than an empty body.
+type Converter interface {
+	Name() string
+	Supports(conversionType string) bool
+	Convert(ctx context.Context, files []*multipart.FileHeader, options ConversionOptions, conversionType string) (io.ReadCloser, int64, error)
+}
+
+// GotenbergConverter is the Converter extracted from the former
+// proxyToGotenbergDirect: it streams uploads to the Gotenberg container.
+type GotenbergConverter struct{}
+
+func (GotenbergConverter) Name() string { return "gotenberg" }
+
+func (GotenbergConverter) Supports(conversionType string) bool {
+	switch conversionType {
+	case "libreoffice", "chromium-html", "chromium-markdown":
+		return true
+	default:
+		return false
+	}
+}
+
+func (GotenbergConverter) Convert(ctx context.Context, files []*multipart.FileHeader, options ConversionOptions, conversionType string) (io.ReadCloser, int64, error) {
+	resp, err := proxyToGotenbergDirectStream(files, conversionType, options)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// LocalLibreOfficeConverter shells out to a local `soffice` headless install
+// when Gotenberg is unavailable. It only supports the libreoffice conversion
+// type, since that's the one soffice itself handles.
+type LocalLibreOfficeConverter struct {
+	// Binary is the soffice executable name or path; defaults to "soffice".
+	Binary string
+}
+
+func (c LocalLibreOfficeConverter) Name() string { return "local-libreoffice" }
+
+func (LocalLibreOfficeConverter) Supports(conversionType string) bool {
+	return conversionType == "libreoffice"
+}
+
+func (c LocalLibreOfficeConverter) binary() string {
+	if c.Binary != "" {
+		return c.Binary
+	}
+	return "soffice"
+}
+
+func (c LocalLibreOfficeConverter) Convert(ctx context.Context, files []*multipart.FileHeader, options ConversionOptions, conversionType string) (io.ReadCloser, int64, error) {
+	if len(files) != 1 {
+		return nil, 0, fmt.Errorf("local LibreOffice fallback only supports a single file at a time")
+	}
+
+	workDir, err := os.MkdirTemp("./temp", "soffice-")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create temp dir: %v", err)
+	}
+
+	inputPath, err := saveUploadToDir(files[0], workDir)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, err
+	}
+
+	cmd := exec.CommandContext(ctx, c.binary(), "--headless", "--convert-to", "pdf", "--outdir", workDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, fmt.Errorf("soffice conversion failed: %v: %s", err, string(output))
+	}
+
+	outputPath := filepath.Join(workDir, trimExtension(filepath.Base(inputPath))+".pdf")
+	size, err := fileSize(outputPath)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, fmt.Errorf("failed to stat converted PDF: %v", err)
+	}
+	file, err := os.Open(outputPath)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, fmt.Errorf("failed to open converted PDF: %v", err)
+	}
+
+	return &tempDirCleanupReader{File: file, dir: workDir}, size, nil
+}
+
+// ChromiumCDPConverter renders HTML/URL jobs through a local headless Chrome
+// install. It drives Chrome's own `--print-to-pdf` CLI flag rather than
+// speaking the DevTools Protocol directly, since that keeps the fallback
+// dependency-free; a true CDP client is a reasonable follow-up once the
+// module has a go.mod to pull chromedp in.
+type ChromiumCDPConverter struct {
+	// Binary is the Chrome/Chromium executable; defaults to "chromium".
+	Binary string
+}
+
+func (c ChromiumCDPConverter) Name() string { return "chromium-cdp" }
+
+func (ChromiumCDPConverter) Supports(conversionType string) bool {
+	switch conversionType {
+	case "chromium-html", "chromium-url":
+		return true
+	default:
+		return false
+	}
+}
+
+func (c ChromiumCDPConverter) binary() string {
+	if c.Binary != "" {
+		return c.Binary
+	}
+	return "chromium"
+}
+
+func (c ChromiumCDPConverter) Convert(ctx context.Context, files []*multipart.FileHeader, options ConversionOptions, conversionType string) (io.ReadCloser, int64, error) {
+	var target string
+	var workDir string
+
+	switch conversionType {
+	case "chromium-url":
+		if options.URL == "" {
+			return nil, 0, fmt.Errorf("url is required for chromium-url conversion")
+		}
+		if err := validateURLForSSRF(options.URL); err != nil {
+			return nil, 0, err
+		}
+		target = options.URL
+	case "chromium-html":
+		if len(files) != 1 {
+			return nil, 0, fmt.Errorf("local Chromium fallback only supports a single HTML file at a time")
+		}
+		var err error
+		workDir, err = os.MkdirTemp("./temp", "chromium-")
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create temp dir: %v", err)
+		}
+		inputPath, err := saveUploadToDir(files[0], workDir)
+		if err != nil {
+			os.RemoveAll(workDir)
+			return nil, 0, err
+		}
+		target = "file://" + inputPath
+	default:
+		return nil, 0, fmt.Errorf("unsupported conversion type for chromium fallback: %s", conversionType)
+	}
+
+	if workDir == "" {
+		var err error
+		workDir, err = os.MkdirTemp("./temp", "chromium-")
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create temp dir: %v", err)
+		}
+	}
+	outputPath := filepath.Join(workDir, "output.pdf")
+
+	args := []string{"--headless", "--disable-gpu", "--no-sandbox", "--print-to-pdf=" + outputPath}
+	if options.PrintBackground {
+		args = append(args, "--print-to-pdf-no-header")
+	}
+	args = append(args, target)
+
+	cmd := exec.CommandContext(ctx, c.binary(), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, fmt.Errorf("chromium conversion failed: %v: %s", err, string(output))
+	}
+
+	size, err := fileSize(outputPath)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, fmt.Errorf("failed to stat rendered PDF: %v", err)
+	}
+	file, err := os.Open(outputPath)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, 0, fmt.Errorf("failed to open rendered PDF: %v", err)
+	}
+	return &tempDirCleanupReader{File: file, dir: workDir}, size, nil
+}
+
+// ConverterChain tries each backend in order, moving to the next on error so
+// the first available one wins. The one exception: if Gotenberg fails while
+// its /health check passes, the chain stops there without trying the local
+// backends. Each attempted backend's error is folded into the final error.
+type ConverterChain struct {
+	Converters []Converter
+}
+
+func NewConverterChain(converters ...Converter) *ConverterChain {
+	return &ConverterChain{Converters: converters}
+}
+
+func (c *ConverterChain) Convert(ctx context.Context, files []*multipart.FileHeader, options ConversionOptions, conversionType string) (io.ReadCloser, int64, error) {
+	var errs []string
+	for _, conv := range c.Converters {
+		if !conv.Supports(conversionType) {
+			continue
+		}
+		result, size, err := conv.Convert(ctx, files, options, conversionType)
+		if err == nil {
+			return result, size, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", conv.Name(), err))
+
+		// Local converters only exist to cover for a down Gotenberg. If
+		// Gotenberg itself failed but /health says it's reachable, the
+		// failure is about this request (e.g. a malformed upload), and
+		// falling back to soffice/chromium would just mask that behind a
+		// different, misleading error instead of surfacing it.
+		if conv.Name() == "gotenberg" && isGotenbergHealthy() {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, 0, fmt.Errorf("no converter backend supports conversion type: %s", conversionType)
+	}
+	return nil, 0, fmt.Errorf("all converter backends failed: %s", joinErrors(errs))
+}
+
+func joinErrors(errs []string) string {
+	out := ""
+	for i, e := range errs {
+		if i > 0 {
+			out += "; "
+		}
+		out += e
+	}
+	return out
+}
+
+// defaultConverterChain tries Gotenberg first, then falls back to a local
+// LibreOffice or Chromium install when the container is unreachable.
+var defaultConverterChain = NewConverterChain(
+	GotenbergConverter{},
+	LocalLibreOfficeConverter{},
+	ChromiumCDPConverter{},
+)
+
+func saveUploadToDir(fileHeader *multipart.FileHeader, dir string) (string, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %v", fileHeader.Filename, err)
+	}
+	defer src.Close()
+
+	destPath := filepath.Join(dir, filepath.Base(fileHeader.Filename))
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer dest.Close()
+
+	if _, err := io.Copy(dest, src); err != nil {
+		return "", fmt.Errorf("failed to write temp file: %v", err)
+	}
+	return destPath, nil
+}
+
+func trimExtension(name string) string {
+	ext := filepath.Ext(name)
+	return name[:len(name)-len(ext)]
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// tempDirCleanupReader closes its backing file and removes the temp
+// directory it lived in once the caller is done reading the result.
+type tempDirCleanupReader struct {
+	*os.File
+	dir string
+}
+
+func (r *tempDirCleanupReader) Close() error {
+	err := r.File.Close()
+	os.RemoveAll(r.dir)
+	return err
+}
+
+// isGotenbergHealthy checks Gotenberg's /health endpoint. ConverterChain uses
+// it after a Gotenberg failure to decide whether to try a local fallback.
+func isGotenbergHealthy() bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(getGotenbergURL() + "/health")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScreenshotOptions configures Gotenberg's Chromium screenshot routes.
+type ScreenshotOptions struct {
+	Format         string  `json:"format"` // "png" (default), "jpeg", "webp"
+	Quality        int     `json:"quality"`
+	OmitBackground bool    `json:"omitBackground"`
+	Width          float64 `json:"width"`
+	Height         float64 `json:"height"`
+}
+
+// registerPipelineRoutes wires the PDF post-processing and screenshot
+// endpoints that sit on top of Gotenberg's pdfengines and Chromium screenshot
+// forms: merge, PDF/A conversion, metadata read/write, and screenshots. Every
+// route here triggers a Gotenberg conversion, so each is gated behind
+// requireAPIKey the same way /convert and /convert-url are.
+func registerPipelineRoutes(r *gin.Engine) {
+	r.POST("/merge", requireAPIKey("convert:pdfengines"), handleMerge)
+	r.POST("/pdfa", requireAPIKey("convert:pdfengines"), handlePDFA)
+	r.POST("/metadata/write", requireAPIKey("convert:pdfengines"), handleMetadataWrite)
+	r.POST("/metadata/read", requireAPIKey("convert:pdfengines"), handleMetadataRead)
+
+	r.POST("/screenshot/html", requireAPIKey("convert:screenshot"), handleScreenshotHTML)
+	r.POST("/screenshot/url", requireAPIKey("convert:screenshot"), handleScreenshotURL)
+	r.POST("/screenshot/markdown", requireAPIKey("convert:screenshot"), handleScreenshotMarkdown)
+}
+
+func handleMerge(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["files"]
+	if len(files) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merge requires at least 2 files"})
+		return
+	}
+
+	result, err := proxyFilesToGotenberg("/forms/pdfengines/merge", files, nil)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "merge failed: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=merged.pdf")
+	c.Data(http.StatusOK, "application/pdf", result)
+	recordAPIKeyUsage(c, 1, sumFileSizes(files), int64(len(result)))
+}
+
+func handlePDFA(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+
+	pdfaFormat := c.PostForm("pdfa")
+	if pdfaFormat == "" {
+		pdfaFormat = "PDF/A-2b"
+	}
+	fields := map[string]string{"pdfa": pdfaFormat}
+	if c.PostForm("pdfua") == "true" {
+		fields["pdfua"] = "true"
+	}
+
+	result, err := proxyFilesToGotenberg("/forms/pdfengines/convert", files, fields)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "PDF/A conversion failed: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=converted.pdf")
+	c.Data(http.StatusOK, "application/pdf", result)
+	recordAPIKeyUsage(c, 1, sumFileSizes(files), int64(len(result)))
+}
+
+func handleMetadataWrite(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+	metadata := c.PostForm("metadata")
+	if metadata == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "metadata field is required (JSON object)"})
+		return
+	}
+
+	result, err := proxyFilesToGotenberg("/forms/pdfengines/metadata/write", files, map[string]string{"metadata": metadata})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "metadata write failed: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=metadata.pdf")
+	c.Data(http.StatusOK, "application/pdf", result)
+	recordAPIKeyUsage(c, 1, sumFileSizes(files), int64(len(result)))
+}
+
+func handleMetadataRead(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+
+	result, err := proxyFilesToGotenberg("/forms/pdfengines/metadata/read", files, nil)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "metadata read failed: " + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", result)
+	recordAPIKeyUsage(c, 1, sumFileSizes(files), int64(len(result)))
+}
+
+func handleScreenshotHTML(c *gin.Context) {
+	runScreenshot(c, "/forms/chromium/screenshot/html")
+}
+
+func handleScreenshotURL(c *gin.Context) {
+	form, err := c.MultipartForm()
+	opts := parseScreenshotOptions(c)
+	if err == nil && len(form.File["files"]) > 0 {
+		runScreenshot(c, "/forms/chromium/screenshot/url")
+		return
+	}
+
+	url := c.PostForm("url")
+	if url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+	if err := validateURLForSSRF(url); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := proxyScreenshotURL(url, opts)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "screenshot failed: " + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, screenshotContentType(opts.Format), result)
+	recordAPIKeyUsage(c, 1, int64(len(url)), int64(len(result)))
+}
+
+func handleScreenshotMarkdown(c *gin.Context) {
+	runScreenshot(c, "/forms/chromium/screenshot/markdown")
+}
+
+func parseScreenshotOptions(c *gin.Context) ScreenshotOptions {
+	opts := ScreenshotOptions{Format: c.PostForm("format")}
+	if opts.Format == "" {
+		opts.Format = "png"
+	}
+	fmt.Sscanf(c.PostForm("quality"), "%d", &opts.Quality)
+	opts.OmitBackground = c.PostForm("omitBackground") == "true"
+	return opts
+}
+
+func runScreenshot(c *gin.Context, endpoint string) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+
+	opts := parseScreenshotOptions(c)
+	fields := map[string]string{"format": opts.Format}
+	if opts.Quality > 0 {
+		fields["quality"] = fmt.Sprintf("%d", opts.Quality)
+	}
+	if opts.OmitBackground {
+		fields["omitBackground"] = "true"
+	}
+
+	result, err := proxyFilesToGotenbergEndpoint(endpoint, files, fields)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "screenshot failed: " + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, screenshotContentType(opts.Format), result)
+	recordAPIKeyUsage(c, 1, sumFileSizes(files), int64(len(result)))
+}
+
+func screenshotContentType(format string) string {
+	switch format {
+	case "jpeg":
+		return "image/jpeg"
+	case "webp":
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
+
+// proxyFilesToGotenberg posts files plus optional extra form fields to a
+// Gotenberg pdfengines/chromium route and returns the raw response body.
+func proxyFilesToGotenberg(endpoint string, files []*multipart.FileHeader, fields map[string]string) ([]byte, error) {
+	return proxyFilesToGotenbergEndpoint(endpoint, files, fields)
+}
+
+func proxyFilesToGotenbergEndpoint(endpoint string, files []*multipart.FileHeader, fields map[string]string) ([]byte, error) {
+	gotenbergURL := getGotenbergURL()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	for _, fileHeader := range files {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %s: %v", fileHeader.Filename, err)
+		}
+		part, err := writer.CreateFormFile("files", fileHeader.Filename)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create form file: %v", err)
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to copy file content: %v", err)
+		}
+		file.Close()
+	}
+
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest("POST", gotenbergURL+endpoint, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Gotenberg: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// proxyScreenshotURL takes a screenshot of a live URL via Gotenberg's
+// /forms/chromium/screenshot/url route.
+func proxyScreenshotURL(url string, opts ScreenshotOptions) ([]byte, error) {
+	gotenbergURL := getGotenbergURL()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("url", url)
+	writer.WriteField("format", opts.Format)
+	if opts.Quality > 0 {
+		writer.WriteField("quality", fmt.Sprintf("%d", opts.Quality))
+	}
+	if opts.OmitBackground {
+		writer.WriteField("omitBackground", "true")
+	}
+	writer.Close()
+
+	req, err := http.NewRequest("POST", gotenbergURL+"/forms/chromium/screenshot/url", &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Gotenberg: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return io.ReadAll(resp.Body)
+}
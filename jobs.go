@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newJobID returns a random hex identifier, good enough to key an in-memory
+// (or Bolt/SQLite-backed) job store without pulling in a UUID dependency.
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// JobStatus is the lifecycle state of an async conversion job.
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job is a single async conversion request tracked from submission through
+// completion. The PDF bytes are only populated once Gotenberg's webhook
+// callback marks the job done.
+type Job struct {
+	ID             string    `json:"id"`
+	Status         JobStatus `json:"status"`
+	ConversionType string    `json:"conversionType"`
+	ResultFilename string    `json:"resultFilename"`
+	WaitTimeout    int       `json:"waitTimeout"` // seconds
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+
+	result []byte
+}
+
+// JobStore persists job metadata and results. FileJobStore is the default,
+// writing each job to disk so it survives a restart; MemoryJobStore
+// satisfies the same interface for tests or single-shot deployments where
+// losing in-flight jobs on restart is acceptable.
+type JobStore interface {
+	Create(job *Job) error
+	Get(id string) (*Job, error)
+	Update(job *Job) error
+	SetResult(id string, data []byte) error
+}
+
+// MemoryJobStore is an in-memory JobStore, suitable for tests or a single
+// instance where job persistence does not need to survive a restart; it is
+// also what newDefaultJobStore falls back to when FileJobStore can't open.
+type MemoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]*Job)}
+}
+
+func (s *MemoryJobStore) Create(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	return job, nil
+}
+
+func (s *MemoryJobStore) Update(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		return fmt.Errorf("job not found: %s", job.ID)
+	}
+	job.UpdatedAt = time.Now()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) SetResult(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+	job.result = data
+	job.Status = JobDone
+	job.UpdatedAt = time.Now()
+	return nil
+}
+
+// jobStore is the process-wide job store.
+var jobStore JobStore = newDefaultJobStore()
+
+// newDefaultJobStore opens a FileJobStore under JOBS_DATA_DIR (or
+// ./data/jobs) so job metadata and results survive a restart. Falls back to
+// an in-memory store only if the data directory can't be created.
+func newDefaultJobStore() JobStore {
+	dir := os.Getenv("JOBS_DATA_DIR")
+	if dir == "" {
+		dir = "./data/jobs"
+	}
+	store, err := NewFileJobStore(dir)
+	if err != nil {
+		log.Printf("job store: %v; falling back to in-memory (jobs will not survive a restart)", err)
+		return NewMemoryJobStore()
+	}
+	return store
+}
+
+// JobRequest is the payload for POST /jobs. It mirrors ConversionRequest but
+// adds the fields needed to run the conversion asynchronously via Gotenberg's
+// webhook support.
+type JobRequest struct {
+	ConversionType string            `json:"conversionType"`
+	Options        ConversionOptions `json:"options"`
+	ResultFilename string            `json:"resultFilename"`
+	WaitTimeout    int               `json:"waitTimeout"`
+}
+
+// webhookBaseURL is the externally reachable base URL Gotenberg should call
+// back to once a job finishes. It must be set for /jobs to work, since
+// Gotenberg needs a URL it can reach, not localhost on the API's side.
+func webhookBaseURL() string {
+	if v := os.Getenv("WEBHOOK_BASE_URL"); v != "" {
+		return v
+	}
+	return "http://localhost:8080"
+}
+
+// registerJobRoutes wires the async job submission, polling, result, and
+// Gotenberg webhook callback endpoints. Submission and result retrieval
+// trigger/serve a conversion, so both sit behind requireAPIKey like
+// /convert does; status polling is cheap and stays open, and the webhook
+// callbacks are called by Gotenberg itself, not a Bearer-bearing client.
+func registerJobRoutes(r *gin.Engine) {
+	r.POST("/jobs", requireAPIKey("convert:jobs"), handleCreateJob)
+	r.GET("/jobs/:id", handleGetJobStatus)
+	r.GET("/jobs/:id/result", requireAPIKey("convert:jobs"), handleGetJobResult)
+	r.POST("/jobs/:id/callback", handleJobWebhookCallback)
+	r.POST("/jobs/:id/callback/error", handleJobWebhookErrorCallback)
+}
+
+func handleCreateJob(c *gin.Context) {
+	var jobReq JobRequest
+	if conversionTypeStr := c.PostForm("conversionType"); conversionTypeStr != "" {
+		jobReq.ConversionType = conversionTypeStr
+	} else {
+		jobReq.ConversionType = "libreoffice"
+	}
+	jobReq.ResultFilename = c.PostForm("resultFilename")
+	if jobReq.ResultFilename == "" {
+		jobReq.ResultFilename = fmt.Sprintf("converted_%s.pdf", time.Now().Format("20060102150405"))
+	}
+	fmt.Sscanf(c.PostForm("waitTimeout"), "%d", &jobReq.WaitTimeout)
+	if jobReq.WaitTimeout == 0 {
+		jobReq.WaitTimeout = 30
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+
+	job := &Job{
+		ID:             newJobID(),
+		Status:         JobPending,
+		ConversionType: jobReq.ConversionType,
+		ResultFilename: jobReq.ResultFilename,
+		WaitTimeout:    jobReq.WaitTimeout,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if err := jobStore.Create(job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := submitJobToGotenberg(job, files, jobReq.Options); err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		jobStore.Update(job)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to submit job: " + err.Error()})
+		return
+	}
+
+	job.Status = JobRunning
+	jobStore.Update(job)
+
+	// The callback that eventually delivers the result runs with no API key
+	// in context, so bytesOut can't be metered here; bytesIn is charged now,
+	// against the key that submitted the job.
+	recordAPIKeyUsage(c, 1, sumFileSizes(files), 0)
+	c.JSON(http.StatusAccepted, gin.H{"id": job.ID, "status": job.Status})
+}
+
+// submitJobToGotenberg proxies the upload to Gotenberg with the webhook
+// headers set, so Gotenberg processes the conversion out-of-band and POSTs
+// the result back to /jobs/:id/callback when it's ready.
+func submitJobToGotenberg(job *Job, files []*multipart.FileHeader, options ConversionOptions) error {
+	extraHeaders := map[string]string{
+		"Gotenberg-Webhook-Url":               fmt.Sprintf("%s/jobs/%s/callback", webhookBaseURL(), job.ID),
+		"Gotenberg-Webhook-Error-Url":          fmt.Sprintf("%s/jobs/%s/callback/error", webhookBaseURL(), job.ID),
+		"Gotenberg-Webhook-Method":             "POST",
+		"Gotenberg-Webhook-Extra-Http-Headers": fmt.Sprintf(`{"X-Job-Id":"%s"}`, job.ID),
+	}
+	return proxyToGotenbergAsync(files, job.ConversionType, options, extraHeaders)
+}
+
+func handleGetJobStatus(c *gin.Context) {
+	job, err := jobStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func handleGetJobResult(c *gin.Context) {
+	job, err := jobStore.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if job.Status != JobDone {
+		c.JSON(http.StatusConflict, gin.H{"error": "job not finished", "status": job.Status})
+		return
+	}
+	serveBytesWithRange(c, job.result, ServeHeaderOptions{
+		ContentType:   "application/pdf",
+		Filename:      job.ResultFilename,
+		LastModified:  job.UpdatedAt,
+		CacheDuration: time.Hour,
+	})
+}
+
+// handleJobWebhookCallback receives Gotenberg's success webhook POST (set as
+// Gotenberg-Webhook-Url) and stores the resulting PDF bytes.
+func handleJobWebhookCallback(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := jobStore.Get(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read webhook body: " + err.Error()})
+		return
+	}
+
+	if err := jobStore.SetResult(id, body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// handleJobWebhookErrorCallback receives Gotenberg's error webhook POST (set
+// as Gotenberg-Webhook-Error-Url) and marks the job failed with the error
+// body Gotenberg sent, instead of storing it as if it were the PDF result.
+func handleJobWebhookErrorCallback(c *gin.Context) {
+	id := c.Param("id")
+	job, err := jobStore.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read webhook body: " + err.Error()})
+		return
+	}
+
+	job.Status = JobFailed
+	job.Error = string(body)
+	if job.Error == "" {
+		job.Error = "Gotenberg reported a conversion failure with no error body"
+	}
+	if err := jobStore.Update(job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
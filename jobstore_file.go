@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileJobStore persists job metadata and results as files on disk, so jobs
+// survive a process restart without pulling in a database dependency this
+// source snapshot has no go.mod to vet one against. BoltDB or SQLite are the
+// natural upgrade once the module has a manifest; until then this satisfies
+// the same durability requirement with the standard library alone. Metadata
+// and result bytes are kept in separate files so polling status doesn't
+// require reading the PDF back in.
+type FileJobStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileJobStore opens (creating if needed) a FileJobStore rooted at dir.
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %v", err)
+	}
+	return &FileJobStore{dir: dir}, nil
+}
+
+func (s *FileJobStore) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileJobStore) resultPath(id string) string {
+	return filepath.Join(s.dir, id+".pdf")
+}
+
+func (s *FileJobStore) writeMeta(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %v", err)
+	}
+	return os.WriteFile(s.metaPath(job.ID), data, 0644)
+}
+
+func (s *FileJobStore) readMeta(id string) (*Job, error) {
+	data, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("job not found: %s", id)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %v", err)
+	}
+	return &job, nil
+}
+
+func (s *FileJobStore) Create(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeMeta(job)
+}
+
+func (s *FileJobStore) Get(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, err := s.readMeta(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == JobDone {
+		if result, err := os.ReadFile(s.resultPath(id)); err == nil {
+			job.result = result
+		}
+	}
+	return job, nil
+}
+
+func (s *FileJobStore) Update(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.metaPath(job.ID)); err != nil {
+		return fmt.Errorf("job not found: %s", job.ID)
+	}
+	job.UpdatedAt = time.Now()
+	return s.writeMeta(job)
+}
+
+func (s *FileJobStore) SetResult(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, err := s.readMeta(id)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.resultPath(id), data, 0644); err != nil {
+		return fmt.Errorf("failed to write job result: %v", err)
+	}
+	job.Status = JobDone
+	job.UpdatedAt = time.Now()
+	return s.writeMeta(job)
+}
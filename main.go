@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -33,14 +34,28 @@ type ConversionOptions struct {
 	NativePageRanges string `json:"nativePageRanges"`
 
 	// Chromium specific
-	PaperWidth      float64 `json:"paperWidth"`
-	PaperHeight     float64 `json:"paperHeight"`
-	MarginTop       float64 `json:"marginTop"`
-	MarginBottom    float64 `json:"marginBottom"`
-	MarginLeft      float64 `json:"marginLeft"`
-	MarginRight     float64 `json:"marginRight"`
-	PrintBackground bool    `json:"printBackground"`
-	Scale           float64 `json:"scale"`
+	PaperWidth        float64 `json:"paperWidth"`
+	PaperHeight       float64 `json:"paperHeight"`
+	MarginTop         float64 `json:"marginTop"`
+	MarginBottom      float64 `json:"marginBottom"`
+	MarginLeft        float64 `json:"marginLeft"`
+	MarginRight       float64 `json:"marginRight"`
+	PrintBackground   bool    `json:"printBackground"`
+	Scale             float64 `json:"scale"`
+	WaitDelay         string  `json:"waitDelay"`         // e.g. "2s"
+	WaitForExpression string  `json:"waitForExpression"` // JS expression Chromium polls until truthy
+	EmulatedMediaType string  `json:"emulatedMediaType"`  // "screen" or "print"
+	PreferCSSPageSize bool    `json:"preferCssPageSize"`
+	SinglePage        bool    `json:"singlePage"`
+
+	// HeaderHTML/FooterHTML are sent to Gotenberg as header.html/footer.html
+	// multipart parts rather than form fields.
+	HeaderHTML string `json:"headerHtml"`
+	FooterHTML string `json:"footerHtml"`
+
+	// ExtraHTTPHeaders are forwarded to Chromium as the extraHttpHeaders
+	// form field (JSON-encoded map).
+	ExtraHTTPHeaders map[string]string `json:"extraHttpHeaders"`
 
 	// URL conversion specific
 	URL string `json:"url"`
@@ -50,8 +65,11 @@ type ConversionOptions struct {
 }
 
 type URLConversionRequest struct {
-	URL     string            `json:"url"`
-	Options ConversionOptions `json:"options"`
+	URL          string            `json:"url"`
+	Options      ConversionOptions `json:"options"`
+	Mode         string            `json:"mode"` // "raw" (default) or "readable"
+	UserAgent    string            `json:"userAgent"`
+	ExtraHeaders map[string]string `json:"extraHeaders"`
 }
 
 
@@ -64,10 +82,12 @@ func getGotenbergURL() string {
 	return gotenbergURL
 }
 
-func proxyToGotenbergDirect(files []*multipart.FileHeader, conversionType string, options ConversionOptions) ([]byte, error) {
+// proxyToGotenbergAsync submits a conversion to Gotenberg with webhook
+// headers set so Gotenberg processes it out-of-band and POSTs the result to
+// the configured callback URL instead of returning it on this response.
+func proxyToGotenbergAsync(files []*multipart.FileHeader, conversionType string, options ConversionOptions, webhookHeaders map[string]string) error {
 	gotenbergURL := getGotenbergURL()
 
-	// Determine endpoint based on conversion type
 	var endpoint string
 	switch conversionType {
 	case "libreoffice":
@@ -81,95 +101,84 @@ func proxyToGotenbergDirect(files []*multipart.FileHeader, conversionType string
 	case "chromium-markdown":
 		endpoint = "/forms/chromium/convert/markdown"
 	default:
-		return nil, fmt.Errorf("unsupported conversion type: %s", conversionType)
+		return fmt.Errorf("unsupported conversion type: %s", conversionType)
 	}
 
-	// Create multipart form
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
 
-	// Add files to form
 	for _, fileHeader := range files {
 		file, err := fileHeader.Open()
 		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s: %v", fileHeader.Filename, err)
+			return fmt.Errorf("failed to open file %s: %v", fileHeader.Filename, err)
 		}
-		defer file.Close()
-
-		// Create form file field
 		part, err := writer.CreateFormFile("files", fileHeader.Filename)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create form file: %v", err)
+			file.Close()
+			return fmt.Errorf("failed to create form file: %v", err)
 		}
-
-		// Copy file content directly from upload
 		if _, err := io.Copy(part, file); err != nil {
-			return nil, fmt.Errorf("failed to copy file content: %v", err)
+			file.Close()
+			return fmt.Errorf("failed to copy file content: %v", err)
 		}
+		file.Close()
 	}
 
-	// Add conversion options based on type
 	addGotenbergOptions(writer, conversionType, options)
-
-	// Close the writer
 	writer.Close()
 
-	// Create request to Gotenberg
 	req, err := http.NewRequest("POST", gotenbergURL+endpoint, &buf)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return fmt.Errorf("failed to create request: %v", err)
 	}
-
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	for key, value := range webhookHeaders {
+		req.Header.Set(key, value)
+	}
 
-	// Send request
-	client := &http.Client{Timeout: 60 * time.Second}
+	// Gotenberg acknowledges webhook-mode requests immediately with 200 and
+	// delivers the actual result later via the webhook callback.
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request to Gotenberg: %v", err)
+		return fmt.Errorf("failed to send request to Gotenberg: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Read response
-	result, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
 	}
-
-	return result, nil
+	return nil
 }
 
+// proxyURLToGotenberg hands the target URL straight to Gotenberg's own
+// Chromium route, so Gotenberg's browser navigates, executes JS, and follows
+// redirects itself — unlike convertReadableURL, which fetches and flattens
+// the page on our side first. validateURLForSSRF is re-checked here (in
+// addition to the caller's pre-flight check) since this is the one path
+// where the URL we validated is also the one Gotenberg itself will fetch.
 func proxyURLToGotenberg(url string, options ConversionOptions) ([]byte, error) {
+	if err := validateURLForSSRF(url); err != nil {
+		return nil, err
+	}
+
 	gotenbergURL := getGotenbergURL()
 	endpoint := "/forms/chromium/convert/url"
 
-	// Create multipart form
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
 
-	// Add URL
 	writer.WriteField("url", url)
-
-	// Add conversion options
 	addGotenbergOptions(writer, "chromium-url", options)
-
-	// Close the writer
 	writer.Close()
 
-	// Create request to Gotenberg
 	req, err := http.NewRequest("POST", gotenbergURL+endpoint, &buf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
-
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	// Send request
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -182,12 +191,10 @@ func proxyURLToGotenberg(url string, options ConversionOptions) ([]byte, error)
 		return nil, fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	// Read response
 	result, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
-
 	return result, nil
 }
 
@@ -233,6 +240,43 @@ func addGotenbergOptions(writer *multipart.Writer, conversionType string, option
 		if options.Scale > 0 {
 			writer.WriteField("scale", fmt.Sprintf("%.2f", options.Scale))
 		}
+		if options.WaitDelay != "" {
+			writer.WriteField("waitDelay", options.WaitDelay)
+		}
+		if options.WaitForExpression != "" {
+			writer.WriteField("waitForExpression", options.WaitForExpression)
+		}
+		if options.EmulatedMediaType != "" {
+			writer.WriteField("emulatedMediaType", options.EmulatedMediaType)
+		}
+		if options.PreferCSSPageSize {
+			writer.WriteField("preferCssPageSize", "true")
+		}
+		if options.SinglePage {
+			writer.WriteField("singlePage", "true")
+		}
+		if len(options.ExtraHTTPHeaders) > 0 {
+			if encoded, err := json.Marshal(options.ExtraHTTPHeaders); err == nil {
+				writer.WriteField("extraHttpHeaders", string(encoded))
+			}
+		}
+		addHeaderFooterParts(writer, options)
+	}
+}
+
+// addHeaderFooterParts uploads header.html/footer.html as multipart file
+// parts, matching what Gotenberg's Chromium routes expect instead of plain
+// form fields.
+func addHeaderFooterParts(writer *multipart.Writer, options ConversionOptions) {
+	if options.HeaderHTML != "" {
+		if part, err := writer.CreateFormFile("files", "header.html"); err == nil {
+			part.Write([]byte(options.HeaderHTML))
+		}
+	}
+	if options.FooterHTML != "" {
+		if part, err := writer.CreateFormFile("files", "footer.html"); err == nil {
+			part.Write([]byte(options.FooterHTML))
+		}
 	}
 }
 
@@ -250,9 +294,15 @@ func main() {
 			username: password,
 		}))
 
-		auth.GET("/admin", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"message": "Admin page"})
-		})
+		// API key management: creating/listing keys still requires the
+		// admin BasicAuth credentials; the keys themselves gate /convert
+		// and /convert-url via requireAPIKey.
+		registerAdminKeyRoutes(auth)
+	} else {
+		// Every conversion route requires an API key, and admin routes are
+		// the only way to mint one -- without them the service is permanently
+		// unreachable, so make that loud instead of a silent wall of 401s.
+		log.Printf("WARNING: USERNAME/PASSWORD not set; admin key routes are disabled, so no API keys can be issued and every requireAPIKey-gated route will return 401")
 	}
 
 	// Configure CORS
@@ -272,28 +322,20 @@ func main() {
 
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
-		gotenbergURL := getGotenbergURL()
-
-		// Check Gotenberg availability
-		client := &http.Client{Timeout: 5 * time.Second}
-		resp, err := client.Get(gotenbergURL + "/health")
 		gotenbergStatus := "unavailable"
-		if err == nil && resp.StatusCode == http.StatusOK {
+		if isGotenbergHealthy() {
 			gotenbergStatus = "available"
 		}
-		if resp != nil {
-			resp.Body.Close()
-		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"status":       "ok",
 			"gotenberg":    gotenbergStatus,
-			"gotenbergURL": gotenbergURL,
+			"gotenbergURL": getGotenbergURL(),
 		})
 	})
 
 	// Direct file conversion endpoint (streams directly to Gotenberg)
-	r.POST("/convert", func(c *gin.Context) {
+	r.POST("/convert", requireAPIKey(""), func(c *gin.Context) {
 		var conversionReq ConversionRequest
 
 		// Parse JSON from form field
@@ -303,6 +345,14 @@ func main() {
 			conversionReq.ConversionType = "libreoffice" // default
 		}
 
+		scope := "convert:libreoffice"
+		if strings.HasPrefix(conversionReq.ConversionType, "chromium") {
+			scope = "convert:chromium"
+		}
+		if !requireScope(c, scope) {
+			return
+		}
+
 		// Parse options from form fields
 		conversionReq.Options.Flatten = c.PostForm("flatten") == "true"
 		conversionReq.Options.Merge = c.PostForm("merge") == "true"
@@ -348,25 +398,37 @@ func main() {
 			return
 		}
 
-		// Try Gotenberg first
-		result, err := proxyToGotenbergDirect(files, conversionReq.ConversionType, conversionReq.Options)
+		// Try Gotenberg first, falling back to a local LibreOffice/Chromium
+		// install via the converter chain if the container is unreachable.
+		result, contentLength, err := defaultConverterChain.Convert(c.Request.Context(), files, conversionReq.Options, conversionReq.ConversionType)
 		if err != nil {
-			fmt.Printf("Gotenberg failed: %v, falling back to local processing\n", err)
-
-			// Only fallback for LibreOffice conversions
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gotenberg conversion failed: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Conversion failed: " + err.Error()})
 			return
 		}
+		defer result.Close()
 
-		// Return PDF
 		outputFilename := fmt.Sprintf("converted_%s.pdf", time.Now().Format("20060102150405"))
-		c.Header("Content-Disposition", "attachment; filename="+outputFilename)
-		c.Header("Content-Type", "application/pdf")
-		c.Data(http.StatusOK, "application/pdf", result)
+		serveStreamWithRange(c, result, ServeHeaderOptions{
+			ContentType:   "application/pdf",
+			Filename:      outputFilename,
+			ContentLength: contentLength,
+		})
+		// Page counts aren't tracked yet, so quota accounting treats each
+		// conversion as one page until real PDF page counting lands. bytesOut
+		// is the upstream's reported size, not bytes actually written (e.g. a
+		// Range request writes less) — good enough for quota purposes.
+		// contentLength is -1 when Gotenberg replies without a Content-Length
+		// header (e.g. chunked transfer encoding); clamp so that can't push
+		// recorded usage negative and disable the byte quota.
+		bytesOut := contentLength
+		if bytesOut < 0 {
+			bytesOut = 0
+		}
+		recordAPIKeyUsage(c, 1, sumFileSizes(files), bytesOut)
 	})
 
 	// URL to PDF conversion endpoint
-	r.POST("/convert-url", func(c *gin.Context) {
+	r.POST("/convert-url", requireAPIKey("convert:url"), func(c *gin.Context) {
 		var urlReq URLConversionRequest
 		if err := c.ShouldBindJSON(&urlReq); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -378,8 +440,21 @@ func main() {
 			return
 		}
 
-		// Convert URL to PDF using Gotenberg
-		result, err := proxyURLToGotenberg(urlReq.URL, urlReq.Options)
+		if err := validateURLForSSRF(urlReq.URL); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var result []byte
+		var err error
+		if urlReq.Mode == "readable" {
+			result, err = convertReadableURL(urlReq)
+		} else {
+			// Raw mode lets Gotenberg's own Chromium navigate to the URL, so
+			// JS-rendered/SPA pages convert correctly; the SSRF check above
+			// (and proxyURLToGotenberg's own) covers the URL itself.
+			result, err = proxyURLToGotenberg(urlReq.URL, urlReq.Options)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "URL conversion failed: " + err.Error()})
 			return
@@ -390,8 +465,15 @@ func main() {
 		c.Header("Content-Disposition", "attachment; filename="+outputFilename)
 		c.Header("Content-Type", "application/pdf")
 		c.Data(http.StatusOK, "application/pdf", result)
+		recordAPIKeyUsage(c, 1, int64(len(urlReq.URL)), int64(len(result)))
 	})
 
+	// Async job submission/status/result + Gotenberg webhook callback
+	registerJobRoutes(r)
+
+	// PDF post-processing (merge, PDF/A, metadata) and Chromium screenshots
+	registerPipelineRoutes(r)
+
 	// Get supported conversion types
 	r.GET("/conversion-types", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
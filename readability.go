@@ -0,0 +1,286 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxURLFetchBytes caps how much of a remote page readability mode will
+// read, so a malicious or misconfigured server can't exhaust memory.
+const maxURLFetchBytes = 20 * 1024 * 1024
+
+const maxURLRedirects = 5
+
+// validateURLForSSRF rejects schemes and IP ranges that could be used to
+// reach internal services from a server-side fetch: non-http(s) schemes,
+// loopback, link-local, and other private address ranges. It also honors an
+// optional host allowlist/denylist via the URL_ALLOWLIST/URL_DENYLIST env
+// vars (comma-separated hostnames).
+func validateURLForSSRF(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %s", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("URL must include a host")
+	}
+
+	if denylist := splitHostList(os.Getenv("URL_DENYLIST")); contains(denylist, parsed.Hostname()) {
+		return fmt.Errorf("host is denylisted: %s", parsed.Hostname())
+	}
+	if allowlist := splitHostList(os.Getenv("URL_ALLOWLIST")); len(allowlist) > 0 && !contains(allowlist, parsed.Hostname()) {
+		return fmt.Errorf("host is not in the allowlist: %s", parsed.Hostname())
+	}
+
+	ips, err := net.LookupIP(parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve host: %v", err)
+	}
+	for _, ip := range ips {
+		if isPrivateOrReservedIP(ip) {
+			return fmt.Errorf("resolved to a private/reserved address: %s", ip)
+		}
+	}
+	return nil
+}
+
+func isPrivateOrReservedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified()
+}
+
+func splitHostList(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	hosts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			hosts = append(hosts, p)
+		}
+	}
+	return hosts
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// safeDialContext re-validates the address immediately before connecting,
+// dialing the already-resolved IP directly instead of letting the transport
+// resolve the hostname again. validateURLForSSRF and CheckRedirect only
+// check the hostname at the time they run; without this, a host that
+// resolves safely during that check but DNS-rebinds to an internal address
+// by the time the transport actually connects would slip straight through.
+func safeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve host: %v", err)
+	}
+
+	var dialIP net.IP
+	for _, ip := range ips {
+		if isPrivateOrReservedIP(ip) {
+			return nil, fmt.Errorf("resolved to a private/reserved address: %s", ip)
+		}
+		if dialIP == nil {
+			dialIP = ip
+		}
+	}
+	if dialIP == nil {
+		return nil, fmt.Errorf("no addresses found for host: %s", host)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, net.JoinHostPort(dialIP.String(), port))
+}
+
+// fetchURL retrieves a page with SSRF-safe redirect handling: every hop is
+// re-validated, the redirect count is capped, and the body is limited to
+// maxURLFetchBytes. gzip-encoded responses are decompressed transparently.
+// The transport's DialContext is overridden with safeDialContext so the
+// connect-time address is re-checked too, closing the TOCTOU/DNS-rebinding
+// gap a hostname-only check would leave open.
+func fetchURL(target, userAgent string, extraHeaders map[string]string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxURLRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			return validateURLForSSRF(req.URL.String())
+		},
+		Transport: &http.Transport{DialContext: safeDialContext},
+	}
+
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if userAgent == "" {
+		userAgent = "zakuf-backend/1.0 (+readability)"
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Encoding", "gzip")
+	for k, v := range extraHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch returned status %d", resp.StatusCode)
+	}
+
+	reader := io.Reader(resp.Body)
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress response: %v", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	return io.ReadAll(io.LimitReader(reader, maxURLFetchBytes))
+}
+
+var (
+	// One pattern per element, so each match runs to that element's own
+	// closing tag rather than the first closing tag of any nested element.
+	scriptStyleTagRes = func() []*regexp.Regexp {
+		var res []*regexp.Regexp
+		for _, tag := range []string{"script", "style", "nav", "header", "footer", "aside", "form", "noscript"} {
+			res = append(res, regexp.MustCompile(`(?is)<`+tag+`\b[^>]*>.*?</\s*`+tag+`\s*>`))
+		}
+		return res
+	}()
+	tagRe            = regexp.MustCompile(`(?s)<[^>]+>`)
+	titleRe          = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	whitespaceRe     = regexp.MustCompile(`\s+`)
+)
+
+// extractReadableArticle does a lightweight equivalent of go-readability: it
+// drops script, style, nav, header, footer, aside, form and noscript elements
+// with their content and returns the page title plus plain-text body content
+// suitable for rendering back through a simple HTML template. Ad markup
+// outside those elements (e.g. plain ad divs) is not recognised and is kept.
+func extractReadableArticle(rawHTML string) (title, body string) {
+	if m := titleRe.FindStringSubmatch(rawHTML); len(m) == 2 {
+		title = strings.TrimSpace(html.UnescapeString(stripTags(m[1])))
+	}
+
+	cleaned := rawHTML
+	for _, re := range scriptStyleTagRes {
+		cleaned = re.ReplaceAllString(cleaned, "")
+	}
+	text := stripTags(cleaned)
+	text = html.UnescapeString(text)
+	text = whitespaceRe.ReplaceAllString(text, " ")
+	body = strings.TrimSpace(text)
+	return title, body
+}
+
+func stripTags(s string) string {
+	return tagRe.ReplaceAllString(s, " ")
+}
+
+const readableTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%s</title></head>
+<body>
+<article>
+<h1>%s</h1>
+<p>%s</p>
+</article>
+</body>
+</html>`
+
+// renderReadableHTML wraps extracted article content in a minimal template
+// before handing it to Gotenberg's Chromium HTML converter.
+func renderReadableHTML(title, body string) string {
+	escaped := html.EscapeString(title)
+	return fmt.Sprintf(readableTemplate, escaped, escaped, html.EscapeString(body))
+}
+
+// convertReadableURL implements the "readable" mode for /convert-url: fetch
+// the page ourselves, strip it down to article content, and submit the
+// cleaned HTML to Gotenberg instead of letting Chromium render the raw page.
+func convertReadableURL(req URLConversionRequest) ([]byte, error) {
+	raw, err := fetchURL(req.URL, req.UserAgent, req.ExtraHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL for readability extraction: %v", err)
+	}
+
+	title, body := extractReadableArticle(string(raw))
+	cleanedHTML := renderReadableHTML(title, body)
+
+	return proxyHTMLStringToGotenberg(cleanedHTML, req.Options)
+}
+
+// proxyHTMLStringToGotenberg submits an in-memory HTML document (rather than
+// an uploaded *multipart.FileHeader) to Gotenberg's Chromium HTML route.
+func proxyHTMLStringToGotenberg(htmlContent string, options ConversionOptions) ([]byte, error) {
+	var buf strings.Builder
+	writer := multipart.NewWriter(&buf)
+
+	part, err := writer.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := part.Write([]byte(htmlContent)); err != nil {
+		return nil, fmt.Errorf("failed to write HTML content: %v", err)
+	}
+
+	addGotenbergOptions(writer, "chromium-html", options)
+	writer.Close()
+
+	gotenbergURL := getGotenbergURL()
+	req, err := http.NewRequest("POST", gotenbergURL+"/forms/chromium/convert/html", strings.NewReader(buf.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Gotenberg: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return io.ReadAll(resp.Body)
+}
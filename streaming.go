@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proxyToGotenbergDirectStream pipes uploaded files straight into the
+// outbound Gotenberg request instead of buffering them in a bytes.Buffer
+// first. The multipart body is written on a goroutine through an io.Pipe,
+// so memory use stays bounded regardless of upload size, and the response
+// body is handed back unread so the caller can stream it out in turn.
+func proxyToGotenbergDirectStream(files []*multipart.FileHeader, conversionType string, options ConversionOptions) (*http.Response, error) {
+	gotenbergURL := getGotenbergURL()
+
+	var endpoint string
+	switch conversionType {
+	case "libreoffice":
+		if options.Merge {
+			endpoint = "/forms/libreoffice/merge"
+		} else {
+			endpoint = "/forms/libreoffice/convert"
+		}
+	case "chromium-html":
+		endpoint = "/forms/chromium/convert/html"
+	case "chromium-markdown":
+		endpoint = "/forms/chromium/convert/markdown"
+	default:
+		return nil, fmt.Errorf("unsupported conversion type: %s", conversionType)
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		var err error
+		defer func() {
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			pw.Close()
+		}()
+
+		for _, fileHeader := range files {
+			var file multipart.File
+			file, err = fileHeader.Open()
+			if err != nil {
+				err = fmt.Errorf("failed to open file %s: %v", fileHeader.Filename, err)
+				return
+			}
+
+			var part io.Writer
+			part, err = writer.CreateFormFile("files", fileHeader.Filename)
+			if err != nil {
+				file.Close()
+				err = fmt.Errorf("failed to create form file: %v", err)
+				return
+			}
+			if _, err = io.Copy(part, file); err != nil {
+				file.Close()
+				err = fmt.Errorf("failed to copy file content: %v", err)
+				return
+			}
+			file.Close()
+		}
+
+		addGotenbergOptions(writer, conversionType, options)
+		err = writer.Close()
+	}()
+
+	req, err := http.NewRequest("POST", gotenbergURL+endpoint, pr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// No client-side timeout here: the request body is streamed live as the
+	// upload is read, so an overall deadline would cut off large uploads.
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Gotenberg: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Gotenberg returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+// ServeHeaderOptions mirrors gitea's httplib.ServeHeaderOptions: the set of
+// response headers needed to serve a downloadable file correctly, whether
+// the body is streamed live or already held in memory.
+type ServeHeaderOptions struct {
+	ContentType   string
+	Disposition   string // "attachment" (default) or "inline"
+	Filename      string
+	ContentLength int64 // <= 0 means unknown; Content-Length is omitted
+	CacheDuration time.Duration
+	LastModified  time.Time
+}
+
+func applyServeHeaders(c *gin.Context, opts ServeHeaderOptions) {
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+
+	disposition := opts.Disposition
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	if opts.Filename != "" {
+		c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, opts.Filename))
+	}
+
+	if opts.ContentLength > 0 {
+		c.Header("Content-Length", fmt.Sprintf("%d", opts.ContentLength))
+	}
+
+	if opts.CacheDuration > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(opts.CacheDuration.Seconds())))
+	} else {
+		c.Header("Cache-Control", "no-store")
+	}
+	if !opts.LastModified.IsZero() {
+		c.Header("Last-Modified", opts.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// serveBytesWithRange serves an in-memory payload (e.g. a completed job
+// result) through http.ServeContent so Range, If-Modified-Since, and HEAD
+// are handled the way a static file server would.
+func serveBytesWithRange(c *gin.Context, data []byte, opts ServeHeaderOptions) {
+	applyServeHeaders(c, opts)
+	http.ServeContent(c.Writer, c.Request, opts.Filename, opts.LastModified, bytes.NewReader(data))
+}
+
+// serveStreamWithRange serves a streamed conversion result (e.g. /convert's
+// live response, as opposed to a job result already held in memory). When
+// result is seekable — a local converter's temp file does satisfy
+// io.ReadSeeker — http.ServeContent handles Range, If-Modified-Since, and
+// HEAD exactly like serveBytesWithRange's in-memory path. A live Gotenberg
+// response body can't be seeked, so that case applies headers directly and
+// copies the body straight through; HEAD requests skip the copy, and a
+// Range request just gets the full body back since there's no way to seek
+// into the stream without buffering it first.
+func serveStreamWithRange(c *gin.Context, result io.ReadCloser, opts ServeHeaderOptions) {
+	if seeker, ok := result.(io.ReadSeeker); ok {
+		applyServeHeaders(c, opts)
+		http.ServeContent(c.Writer, c.Request, opts.Filename, opts.LastModified, seeker)
+		return
+	}
+
+	applyServeHeaders(c, opts)
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		io.Copy(c.Writer, result)
+	}
+}